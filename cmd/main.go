@@ -2,33 +2,107 @@ package main
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	// "github.com/labstack/echo/v4/middleware"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store/memory"
+	mongostore "github.com/marcolutz00/cc-ss24-exercise-1/store/mongo"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store/mongo/migrations"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store/postgres"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Defines a "model" that we can use to communicate with the
-// frontend or the database
-// More on these "tags" like `bson:"_id,omitempty"`: https://go.dev/wiki/Well-known-struct-tags
-type BookStore struct {
-	MongoID     primitive.ObjectID `bson:"_id,omitempty"`
-	ID          string             `bson:"id"      json:"id"`
-    BookName    string             `bson:"title"    json:"title"`       
-    BookAuthor  string             `bson:"author"  json:"author"`     
-    BookEdition string             `bson:"edition" json:"edition"`    
-    BookPages   string                `bson:"pages"   json:"pages"`      
-    BookYear    string                `bson:"year"    json:"year"`             
+// BookEvent is one entry of the audit trail kept in the `book_events`
+// collection. It records what happened to a book (created/updated/deleted),
+// who triggered it, when, and a diff of the fields that changed so the log
+// can be replayed without going back to the primary collection.
+type BookEvent struct {
+	MongoID   primitive.ObjectID     `bson:"_id,omitempty" json:"-"`
+	EventType string                 `bson:"event_type" json:"event_type"`
+	BookID    string                 `bson:"book_id" json:"book_id"`
+	Actor     string                 `bson:"actor" json:"actor"`
+	Timestamp time.Time              `bson:"timestamp" json:"timestamp"`
+	Diff      map[string]interface{} `bson:"diff,omitempty" json:"diff,omitempty"`
+}
+
+// BookView, AuthorView and YearView are the typed view models handed to the
+// `views/*.html` templates, replacing the old map[string]interface{} blobs -
+// a typo in a map key used to fail silently at render time, a typo in a
+// struct field fails at compile time instead.
+type BookView struct {
+	ID      string
+	Title   string
+	Author  string
+	Edition string
+	Pages   string
+}
+
+type AuthorView struct {
+	ID          string
+	Author      string
+	AmountBooks int
+}
+
+type YearView struct {
+	ID   string
+	Year string
+}
+
+// SearchResultView, SearchAuthorCountView and SearchYearCountView are the
+// typed view models the "search-results" HTMX fragment renders, adapting
+// the raw bson.M facets findSearchResults returns - same reasoning as
+// BookView/AuthorView/YearView above.
+type SearchResultView struct {
+	ID      string
+	Title   string
+	Author  string
+	Edition string
+	Pages   string
+	Year    string
+}
+
+type SearchAuthorCountView struct {
+	Author string
+	Count  int64
+}
+
+type SearchYearCountView struct {
+	Year  string
+	Count int64
+}
+
+// SearchView is the data handed to the "search-results" template: the
+// matching books plus the two facets rendered as filter sidebars.
+type SearchView struct {
+	Query         string
+	Results       []SearchResultView
+	AuthorCounts  []SearchAuthorCountView
+	YearHistogram []SearchYearCountView
+}
+
+// bookToView adapts a store.Book to the BookView a "book-row" fragment
+// renders - used by the POST/PUT handlers to answer an HTMX request with
+// the freshly created/updated row.
+func bookToView(b store.Book) BookView {
+	return BookView{ID: b.ID, Title: b.Title, Author: b.Author, Edition: b.Edition, Pages: b.Pages}
 }
 
 // Wraps the "Template" struct to associate a necessary method
@@ -37,6 +111,31 @@ type Template struct {
 	tmpl *template.Template
 }
 
+// isbnFormat renders an edition/ISBN string in the familiar
+// 978-x-xxx-xxxxx-x grouping. Anything that isn't a plain 13-digit ISBN-13
+// (dashes and all) is returned unchanged rather than guessed at.
+func isbnFormat(raw string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, raw)
+
+	if len(digits) != 13 {
+		return raw
+	}
+	return digits[0:3] + "-" + digits[3:4] + "-" + digits[4:7] + "-" + digits[7:12] + "-" + digits[12:13]
+}
+
+// pluralize is the classic template helper for "1 book" vs. "2 books".
+func pluralize(word string, count int) string {
+	if count == 1 {
+		return word
+	}
+	return word + "s"
+}
+
 // Preload the available templates for the view folder.
 // This builds a local "database" of all available "blocks"
 // to render upon request, i.e., replace the respective
@@ -46,11 +145,23 @@ type Template struct {
 // You can also read Golang's documentation on their templating
 // https://pkg.go.dev/text/template
 func loadTemplates() *Template {
+	funcMap := template.FuncMap{
+		"isbnFormat": isbnFormat,
+		"pluralize":  pluralize,
+	}
 	return &Template{
-		tmpl: template.Must(template.ParseGlob("views/*.html")),
+		tmpl: template.Must(template.New("").Funcs(funcMap).ParseGlob("views/*.html")),
 	}
 }
 
+// isHxRequest reports whether the request came from an HTMX element (e.g.
+// hx-get/hx-post), identified by the `HX-Request` header HTMX sets on every
+// request it issues. Handlers use this to decide between rendering a full
+// page and rendering just the fragment HTMX will swap in.
+func isHxRequest(c echo.Context) bool {
+	return c.Request().Header.Get("HX-Request") != ""
+}
+
 // Method definition of the required "Render" to be passed for the Rendering
 // engine.
 // Contraire to method declaration, such syntax defines methods for a given
@@ -90,87 +201,125 @@ func prepareDatabase(client *mongo.Client, dbName string, collecName string) (*m
 	return coll, nil
 }
 
+// mongoURI returns the connection string for the Mongo client used for the
+// book_events audit trail (and, when STORAGE_BACKEND=mongo, for the books
+// themselves). Defaults to the local instance the exercise ships against.
+func mongoURI() string {
+	if uri := os.Getenv("MONGO_URI"); uri != "" {
+		return uri
+	}
+	return "mongodb://localhost:27017"
+}
+
+// newBookStore picks the store.BookStore implementation to back
+// /api/books and friends, based on the STORAGE_BACKEND env var:
+//
+//   - "postgres": Postgres via pgx, DSN read from POSTGRES_DSN
+//   - "memory":   in-memory store, useful for running the exercise or tests
+//     without any database at hand
+//   - anything else (default "mongo"): the existing Mongo collection
+//
+// The book_events audit trail is intentionally left out of this choice -
+// it always lives in Mongo, see the comment next to its setup in main().
+//
+// The second return value is the raw Mongo collection backing the store,
+// non-nil only when the mongo backend was selected. /api/search needs it
+// directly since full-text search/aggregation isn't part of the BookStore
+// interface - it's a Mongo-specific capability, not one every backend can
+// offer.
+func newBookStore(ctx context.Context, client *mongo.Client) (store.BookStore, *mongo.Collection, error) {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "postgres":
+		s, err := postgres.Connect(ctx, os.Getenv("POSTGRES_DSN"))
+		return s, nil, err
+	case "memory":
+		return memory.NewStore(), nil, nil
+	default:
+		coll, err := prepareDatabase(client, "exercise-1", "information")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Run the versioned schema migrations before handing the collection
+		// to the store - see store/mongo/migrations for what they do. This
+		// is also where the text index /api/search relies on gets created.
+		runner := migrations.NewRunner(client.Database("exercise-1"))
+		if err := runner.Run(ctx, []migrations.Migration{
+			migrations.NewInitialMigration(coll),
+		}); err != nil {
+			return nil, nil, err
+		}
+
+		return mongostore.NewStore(coll), coll, nil
+	}
+}
+
 // Here we prepare some fictional data and we insert it into the database
 // the first time we connect to it. Otherwise, we check if it already exists.
-func prepareData(client *mongo.Client, coll *mongo.Collection) {
-	startData := []BookStore{
+func seedBooks(ctx context.Context, bs store.BookStore) {
+	startData := []store.Book{
 		{
-			ID:          "example1",
-			BookName:    "The Vortex",
-			BookAuthor:  "JosÃ© Eustasio Rivera",
-			BookEdition: "958-30-0804-4",
-			BookPages:   "292",
-			BookYear:    "1924",
+			ID:      "example1",
+			Title:   "The Vortex",
+			Author:  "José Eustasio Rivera",
+			Edition: "958-30-0804-4",
+			Pages:   "292",
+			Year:    "1924",
 		},
 		{
-			ID:          "example2",
-			BookName:    "Frankenstein",
-			BookAuthor:  "Mary Shelley",
-			BookEdition: "978-3-649-64609-9",
-			BookPages:   "280",
-			BookYear:    "1818",
+			ID:      "example2",
+			Title:   "Frankenstein",
+			Author:  "Mary Shelley",
+			Edition: "978-3-649-64609-9",
+			Pages:   "280",
+			Year:    "1818",
 		},
 		{
-			ID:          "example3",
-			BookName:    "The Black Cat",
-			BookAuthor:  "Edgar Allan Poe",
-			BookEdition: "978-3-99168-238-7",
-			BookPages:   "280",
-			BookYear:    "1843",
+			ID:      "example3",
+			Title:   "The Black Cat",
+			Author:  "Edgar Allan Poe",
+			Edition: "978-3-99168-238-7",
+			Pages:   "280",
+			Year:    "1843",
 		},
 	}
 
 	// This syntax helps us iterate over arrays. It behaves similar to Python
 	// However, range always returns a tuple: (idx, elem). You can ignore the idx
 	// by using _.
-	// In the topic of function returns: sadly, there is no standard on return types from function. Most functions
-	// return a tuple with (res, err), but this is not granted. Some functions
-	// might return a ret value that includes res and the err, others might have
-	// an out parameter.
 	for _, book := range startData {
-		cursor, err := coll.Find(context.TODO(), book)
-		var results []BookStore
-		if err = cursor.All(context.TODO(), &results); err != nil {
+		_, err := bs.Get(ctx, book.ID)
+		if err == nil {
+			continue
+		}
+		if err != store.ErrNotFound {
 			panic(err)
 		}
-		if len(results) > 1 {
-			log.Fatal("more records were found")
-		} else if len(results) == 0 {
-			result, err := coll.InsertOne(context.TODO(), book)
-			if err != nil {
-				panic(err)
-			} else {
-				fmt.Printf("%+v\n", result)
-			}
 
-		} else {
-			for _, res := range results {
-				cursor.Decode(&res)
-				fmt.Printf("%+v\n", res)
-			}
+		if _, err := bs.Create(ctx, book); err != nil {
+			panic(err)
 		}
+		fmt.Printf("%+v\n", book)
 	}
 }
 
 // Generic method to perform "SELECT * FROM BOOKS" (if this was SQL, which
-// it is not :D ), and then we convert it into an array of map. In Golang, you
-// define a map by writing map[<key type>]<value type>{<key>:<value>}.
-// interface{} is a special type in Golang, basically a wildcard...
-func findAllBooks(coll *mongo.Collection) []map[string]interface{} {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
+// it is not :D ), and then we convert it into the BookView the `books`
+// templates render.
+func findAllBooks(bs store.BookStore) []BookView {
+	books, _, err := bs.List(context.TODO(), store.ListParams{})
+	if err != nil {
 		panic(err)
 	}
 
-	var ret []map[string]interface{}
-	for _, res := range results {
-		ret = append(ret, map[string]interface{}{
-			"id":          res.ID,
-			"title":    res.BookName,
-			"author":  res.BookAuthor,
-			"edition": res.BookEdition,
-			"pages":   res.BookPages,
+	ret := make([]BookView, 0, len(books))
+	for _, b := range books {
+		ret = append(ret, BookView{
+			ID:      b.ID,
+			Title:   b.Title,
+			Author:  b.Author,
+			Edition: b.Edition,
+			Pages:   b.Pages,
 		})
 	}
 
@@ -178,90 +327,467 @@ func findAllBooks(coll *mongo.Collection) []map[string]interface{} {
 }
 
 // API Search
-func findAllBooksApi(coll *mongo.Collection) []map[string]interface{} {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		panic(err)
+//
+// Unlike findAllBooks, this variant is meant to be consumed by the JSON:API
+// and therefore supports pagination (skip/limit), sorting, and filtering on
+// top of the plain "SELECT * FROM BOOKS". It also decorates each resource
+// with HATEOAS-style links so a frontend never has to hand-build a book URL.
+// total is the number of books matching the filter (ignoring skip/limit),
+// used by the handler to compute the "last" page link and meta.total.
+func findAllBooksApi(bs store.BookStore, params store.ListParams) ([]map[string]interface{}, int64, error) {
+	books, total, err := bs.List(context.TODO(), params)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	var ret []map[string]interface{}
-	for _, res := range results {
+	for _, b := range books {
 		ret = append(ret, map[string]interface{}{
-			"id":      res.ID,
-			"title":    res.BookName,
-			"author":  res.BookAuthor,
-			"pages":   res.BookPages,
-			"edition": res.BookEdition,
-			"year": res.BookYear,
+			"id":      b.ID,
+			"title":   b.Title,
+			"author":  b.Author,
+			"pages":   b.Pages,
+			"edition": b.Edition,
+			"year":    b.Year,
+			"links": map[string]string{
+				"self":   "/api/books/" + b.ID,
+				"author": "/api/books?filter[author]=" + url.QueryEscape(b.Author),
+				"year":   "/api/books?filter[year]=" + url.QueryEscape(b.Year),
+			},
 		})
 	}
 
-	return ret
+	return ret, total, nil
 }
 
-func findAllAuthors(coll *mongo.Collection) []map[string]interface{} {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		panic(err)
+// buildBookListParams translates the `?filter[...]`, `?sort=`, `?page=` and
+// `?per_page=` query parameters accepted by GET /api/books into the
+// backend-agnostic store.ListParams the chosen BookStore understands.
+func buildBookListParams(c echo.Context) store.ListParams {
+	page, perPage := parsePagination(c)
+
+	params := store.ListParams{
+		Skip:  (page - 1) * perPage,
+		Limit: perPage,
+	}
+	if author := c.QueryParam("filter[author]"); author != "" {
+		params.Author = author
+	}
+	if year := c.QueryParam("filter[year]"); year != "" {
+		params.Year = year
 	}
 
-	authorsM := make(map[string]int)
-	var ret []map[string]interface{}
+	// A leading "-" means descending, matching the JSON:API sort
+	// convention. Every comma-separated key is kept, in order, so ties on
+	// an earlier key are broken by the next one; unknown fields are
+	// dropped rather than passed through to the backend.
+	if sortParam := c.QueryParam("sort"); sortParam != "" {
+		for _, field := range strings.Split(sortParam, ",") {
+			key := store.SortKey{}
+			if strings.HasPrefix(field, "-") {
+				key.Desc = true
+				field = field[1:]
+			}
+			switch field {
+			case "title", "author", "year", "edition":
+				key.Field = field
+			default:
+				continue
+			}
+			params.Sort = append(params.Sort, key)
+		}
+	}
 
-	for _, res := range results {
-        authorsM[res.BookAuthor]++
-    }
+	return params
+}
+
+// parsePagination reads `?page=` and `?per_page=` and falls back to sane
+// defaults (and clamps anything that isn't a positive number) so a malformed
+// query string never turns into a negative skip/limit.
+func parsePagination(c echo.Context) (page int64, perPage int64) {
+	page, perPage = 1, 10
 
-	for author, count := range authorsM {
-		var id string
-		for _, res := range results {
-			if res.BookAuthor == author {
-                id = res.MongoID.Hex()
-                break
-            }
+	if raw := c.QueryParam("page"); raw != "" {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil && v > 0 {
+			page = v
+		}
+	}
+	if raw := c.QueryParam("per_page"); raw != "" {
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil && v > 0 {
+			perPage = v
 		}
+	}
 
-		ret = append(ret, map[string]interface{}{
-			"id":          id,
-			"author":  author,
-			"amountbooks":   count,
+	return page, perPage
+}
+
+// parseOptionalYear reads the named query parameter as an int, returning a
+// nil *int when it's absent so findSearchResults can tell "not supplied"
+// apart from an actual 0. A value that isn't a number is a 400 rather than
+// a silently-ignored filter.
+func parseOptionalYear(c echo.Context, name string) (*int, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, name+" must be an integer")
+	}
+	return &v, nil
+}
+
+// buildCollectionLinks builds the first/prev/next/last navigation links for
+// the /api/books envelope, preserving whatever filter/sort query parameters
+// the caller already supplied and only swapping out page/per_page.
+func buildCollectionLinks(c echo.Context, page int64, perPage int64, lastPage int64) map[string]string {
+	base := c.Request().URL.Path
+	query := c.Request().URL.Query()
+
+	linkFor := func(p int64) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("page", strconv.FormatInt(p, 10))
+		q.Set("per_page", strconv.FormatInt(perPage, 10))
+		return base + "?" + q.Encode()
+	}
+
+	links := map[string]string{
+		"first": linkFor(1),
+		"last":  linkFor(lastPage),
+	}
+	if page > 1 {
+		links["prev"] = linkFor(page - 1)
+	}
+	if page < lastPage {
+		links["next"] = linkFor(page + 1)
+	}
+
+	return links
+}
+
+func findAllAuthors(bs store.BookStore) []AuthorView {
+	counts, err := bs.CountByAuthor(context.TODO())
+	if err != nil {
+		panic(err)
+	}
+
+	ret := make([]AuthorView, 0, len(counts))
+	for _, ac := range counts {
+		ret = append(ret, AuthorView{
+			ID:          ac.Author,
+			Author:      ac.Author,
+			AmountBooks: int(ac.Count),
 		})
-		
 	}
 
 	return ret
 }
 
+func findAllYears(bs store.BookStore) []YearView {
+	years, err := bs.CountByYear(context.TODO())
+	if err != nil {
+		panic(err)
+	}
 
+	ret := make([]YearView, 0, len(years))
+	for _, year := range years {
+		ret = append(ret, YearView{ID: year, Year: year})
+	}
 
-func findAllYears(coll *mongo.Collection) []map[string]interface{} {
-	cursor, err := coll.Find(context.TODO(), bson.D{{}})
-	var results []BookStore
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		panic(err)
+	return ret
+}
+
+// bookETag computes a weak-free ETag for a book's current field values, used
+// by GET/PUT/PATCH/DELETE on /api/books/:id for conditional requests (see
+// the If-Match/If-None-Match handling in main()). It's derived purely from
+// store.Book's fields rather than any raw document bytes, since the backend
+// is pluggable and not every store.BookStore implementation has bytes to
+// hash in the first place.
+func bookETag(b store.Book) string {
+	sum := sha1.Sum([]byte(b.ID + "\x00" + b.Title + "\x00" + b.Author + "\x00" + b.Edition + "\x00" + b.Pages + "\x00" + b.Year))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// checkIfMatch enforces the mandatory If-Match precondition on
+// PUT/PATCH/DELETE /api/books/:id: a missing header is rejected with 428
+// Precondition Required, a stale one with 412 Precondition Failed. Returns
+// nil once the caller has proven it last saw `current`, so the request may
+// proceed without clobbering a concurrent edit.
+func checkIfMatch(ctx echo.Context, current store.Book) error {
+	ifMatch := ctx.Request().Header.Get("If-Match")
+	if ifMatch == "" {
+		return echo.NewHTTPError(http.StatusPreconditionRequired, "If-Match header is required")
+	}
+	if ifMatch != bookETag(current) {
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "If-Match does not match current ETag")
 	}
+	return nil
+}
 
-	yearsM := make(map[string]bool)
-	var ret []map[string]interface{}
+// diffBooks compares two (possibly nil) book snapshots and returns a map
+// of only the fields that changed, each as `{"before": ..., "after": ...}`.
+// before == nil means the book was just created, after == nil means it was
+// just deleted.
+func diffBooks(before *store.Book, after *store.Book) map[string]interface{} {
+	diff := map[string]interface{}{}
 
-	for _, res := range results {
-		if _, exists := yearsM[res.BookYear]; !exists {
-			yearsM[res.BookYear] = true
+	field := func(name string, beforeVal string, afterVal string) {
+		if beforeVal != afterVal {
+			diff[name] = map[string]string{"before": beforeVal, "after": afterVal}
+		}
+	}
+
+	var b, a store.Book
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+
+	field("title", b.Title, a.Title)
+	field("author", b.Author, a.Author)
+	field("edition", b.Edition, a.Edition)
+	field("pages", b.Pages, a.Pages)
+	field("year", b.Year, a.Year)
+
+	return diff
+}
 
-			ret = append(ret, map[string]interface{}{
-				"id":        res.MongoID.Hex(),
-				"year":  res.BookYear,
+// recordEvent appends one entry to the book_events collection. It is called
+// from every POST/PUT/DELETE handler on /api/books so the audit trail always
+// reflects what actually happened to the primary collection. Failures are
+// logged but never fail the originating request - the audit trail is a
+// side-effect, not the source of truth. A nil coll (no Mongo available, see
+// its setup in main()) silently disables the audit trail instead.
+func recordEvent(coll *mongo.Collection, eventType string, bookID string, actor string, before *store.Book, after *store.Book) {
+	if coll == nil {
+		return
+	}
+
+	event := BookEvent{
+		EventType: eventType,
+		BookID:    bookID,
+		Actor:     actor,
+		Timestamp: time.Now().UTC(),
+		Diff:      diffBooks(before, after),
+	}
+
+	if _, err := coll.InsertOne(context.TODO(), event); err != nil {
+		log.Printf("recordEvent: failed to record %s event for book %s: %v", eventType, bookID, err)
+	}
+}
+
+// findEventsByBook returns the audit trail for a single book, newest first.
+func findEventsByBook(coll *mongo.Collection, bookID string) ([]BookEvent, error) {
+	findOpts := options.Find().SetSort(bson.D{{"timestamp", -1}})
+	cursor, err := coll.Find(context.TODO(), bson.M{"book_id": bookID}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []BookEvent
+	if err = cursor.All(context.TODO(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// findEvents returns the global audit trail, optionally narrowed to events
+// at or after `since` and/or of a single `eventType`. It backs
+// GET /api/events?since=<rfc3339>&type=created|updated|deleted.
+func findEvents(coll *mongo.Collection, since *time.Time, eventType string) ([]BookEvent, error) {
+	filter := bson.M{}
+	if since != nil {
+		filter["timestamp"] = bson.M{"$gte": *since}
+	}
+	if eventType != "" {
+		filter["event_type"] = eventType
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{"timestamp", -1}})
+	cursor, err := coll.Find(context.TODO(), filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []BookEvent
+	if err = cursor.All(context.TODO(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// findSearchResults backs GET /api/search. It runs a single aggregation
+// pipeline against the Mongo text index created by the 1_0_0 migration
+// (see store/mongo/migrations) and returns three facets in one round trip:
+// the matching books themselves, a count of matches per author, and a
+// histogram of matches per year. This is Mongo-specific (text search and
+// $facet aren't something store.BookStore can express for every backend),
+// which is why it takes the raw collection rather than going through the
+// interface - see the comment on searchColl in main().
+//
+// `q` is matched against the title/author text index; when empty, every
+// book in the optional author/year range is returned, newest first instead
+// of by text score. `yearFrom`/`yearTo` are inclusive and only applied when
+// non-nil - they must already be parsed ints, since comparing a raw $year
+// expression against a numeric string would compare across BSON types and
+// never match. Years that aren't valid numbers (the 1_0_0 migration
+// deliberately leaves those as-is, see store/mongo/migrations) convert to
+// nil via mongostore.SafeToInt and are excluded by an explicit not-nil check
+// whenever a range is given, rather than aborting the whole aggregation the
+// way a bare $toInt would.
+func findSearchResults(coll *mongo.Collection, q string, author string, yearFrom *int, yearTo *int) (bson.M, error) {
+	match := bson.M{}
+	if q != "" {
+		match["$text"] = bson.M{"$search": q}
+	}
+	if author != "" {
+		match["author"] = author
+	}
+
+	var andExprs []bson.M
+	if yearFrom != nil {
+		andExprs = append(andExprs, bson.M{"$gte": []interface{}{mongostore.SafeToInt("$year"), *yearFrom}})
+	}
+	if yearTo != nil {
+		andExprs = append(andExprs, bson.M{"$lte": []interface{}{mongostore.SafeToInt("$year"), *yearTo}})
+	}
+	if len(andExprs) > 0 {
+		// nil sorts below every number, so $lte alone would let a
+		// non-numeric year through - exclude those explicitly.
+		andExprs = append(andExprs, bson.M{"$ne": []interface{}{mongostore.SafeToInt("$year"), nil}})
+		match["$expr"] = bson.M{"$and": andExprs}
+	}
+
+	pipeline := bson.A{bson.M{"$match": match}}
+	if q != "" {
+		pipeline = append(pipeline, bson.M{"$sort": bson.M{"score": bson.M{"$meta": "textScore"}}})
+	} else {
+		// "year" may be a BSON string or int per document, so sort on the
+		// numeric value rather than the raw field, same as store/mongo.List.
+		pipeline = append(pipeline,
+			bson.M{"$addFields": bson.M{"__year_sort": mongostore.SafeToInt("$year")}},
+			bson.M{"$sort": bson.D{{"__year_sort", -1}}},
+			bson.M{"$unset": "__year_sort"},
+		)
+	}
+
+	pipeline = append(pipeline, bson.M{"$facet": bson.M{
+		"results": bson.A{},
+		"author_counts": bson.A{
+			bson.M{"$group": bson.M{"_id": "$author", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{"count", -1}}},
+		},
+		"year_histogram": bson.A{
+			bson.M{"$group": bson.M{"_id": mongostore.SafeToInt("$year"), "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{"_id", 1}}},
+		},
+	}})
+
+	cursor, err := coll.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []bson.M
+	if err := cursor.All(context.TODO(), &facets); err != nil {
+		return nil, err
+	}
+	if len(facets) == 0 {
+		return bson.M{"results": bson.A{}, "author_counts": bson.A{}, "year_histogram": bson.A{}}, nil
+	}
+	return facets[0], nil
+}
+
+// facetsToSearchView adapts the raw bson.M findSearchResults returns into
+// the typed SearchView the "search-results" HTMX fragment renders -
+// mirrors bookToView/findAllAuthors/findAllYears building their own view
+// models instead of handing map[string]interface{} to a template.
+func facetsToSearchView(q string, facets bson.M) SearchView {
+	view := SearchView{Query: q}
+
+	for _, raw := range bsonArray(facets["results"]) {
+		if doc, ok := raw.(bson.M); ok {
+			view.Results = append(view.Results, SearchResultView{
+				ID:      bsonString(doc["id"]),
+				Title:   bsonString(doc["title"]),
+				Author:  bsonString(doc["author"]),
+				Edition: bsonString(doc["edition"]),
+				Pages:   bsonString(doc["pages"]),
+				Year:    bsonString(doc["year"]),
 			})
 		}
 	}
 
-	return ret
+	for _, raw := range bsonArray(facets["author_counts"]) {
+		if doc, ok := raw.(bson.M); ok {
+			view.AuthorCounts = append(view.AuthorCounts, SearchAuthorCountView{
+				Author: bsonString(doc["_id"]),
+				Count:  bsonInt64(doc["count"]),
+			})
+		}
+	}
+
+	for _, raw := range bsonArray(facets["year_histogram"]) {
+		if doc, ok := raw.(bson.M); ok {
+			view.YearHistogram = append(view.YearHistogram, SearchYearCountView{
+				Year:  bsonString(doc["_id"]),
+				Count: bsonInt64(doc["count"]),
+			})
+		}
+	}
+
+	return view
 }
 
+// bsonArray normalizes the nested-array shape cursor.All hands back for a
+// $facet sub-pipeline (bson.A, or nil for an empty facet) into a plain
+// []interface{} that's easy to range over.
+func bsonArray(v interface{}) []interface{} {
+	switch a := v.(type) {
+	case bson.A:
+		return []interface{}(a)
+	case []interface{}:
+		return a
+	default:
+		return nil
+	}
+}
 
+// bsonString coerces a decoded BSON scalar to its string form regardless of
+// whether it came back as a string, int32 or int64 - the same
+// migration-era ambiguity numericString handles in store/mongo.
+func bsonString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case int32:
+		return strconv.Itoa(int(t))
+	case int64:
+		return strconv.FormatInt(t, 10)
+	default:
+		return ""
+	}
+}
 
+// bsonInt64 coerces a decoded BSON numeric scalar (the output of a $sum) to
+// an int64.
+func bsonInt64(v interface{}) int64 {
+	switch t := v.(type) {
+	case int32:
+		return int64(t)
+	case int64:
+		return t
+	case float64:
+		return int64(t)
+	default:
+		return 0
+	}
+}
 
 func main() {
 	// fmt.Println("Station 0")
@@ -275,8 +801,10 @@ func main() {
 
 	// fmt.Println("Station 1")
 
-	// TODO: make sure to pass the proper username, password, and port
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI()))
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// fmt.Println("Station 2")
 
@@ -288,11 +816,38 @@ func main() {
 		}
 	}()
 
-	// You can use such name for the database and collection, or come up with
-	// one by yourself!
-	coll, err := prepareDatabase(client, "exercise-1", "information")
+	// The book_events audit trail always lives in Mongo, independent of
+	// which STORAGE_BACKEND is selected below for the books themselves -
+	// that abstraction only ever covered the BookStore interface. But when
+	// a non-mongo backend is selected, Mongo may not be reachable at all;
+	// refusing to boot in that case would defeat the point of
+	// STORAGE_BACKEND=postgres|memory, so the audit trail is disabled
+	// rather than fatal and every handler that touches eventsColl treats
+	// nil as "no audit trail available".
+	backend := os.Getenv("STORAGE_BACKEND")
+	eventsColl, err := prepareDatabase(client, "exercise-1", "book_events")
+	if err == nil {
+		_, err = eventsColl.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+			Keys: bson.D{{"book_id", 1}, {"timestamp", -1}},
+		})
+	}
+	if err != nil {
+		if backend == "" || backend == "mongo" {
+			log.Fatal(err)
+		}
+		log.Printf("book_events audit trail disabled, mongo unreachable: %v", err)
+		eventsColl = nil
+	}
 
-	prepareData(client, coll)
+	// Picks Mongo, Postgres, or the in-memory store based on
+	// STORAGE_BACKEND. Every handler below talks to this interface only,
+	// except /api/search which needs the raw Mongo collection (searchColl,
+	// nil unless the mongo backend is active).
+	bookStore, searchColl, err := newBookStore(ctx, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	seedBooks(ctx, bookStore)
 
 	// Here we prepare the server
 	e := echo.New()
@@ -314,18 +869,31 @@ func main() {
 		return c.Render(200, "index", nil)
 	})
 
+	// Renders the full page on a normal GET; on an HTMX GET (e.g. a
+	// hx-trigger="every 5s" polling the table) it renders just the <tr>
+	// rows so HTMX can swap them into the existing table without a full
+	// page reload.
 	e.GET("/books", func(c echo.Context) error {
-		books := findAllBooks(coll)
+		books := findAllBooks(bookStore)
+		if isHxRequest(c) {
+			return c.Render(200, "books-rows", books)
+		}
 		return c.Render(200, "books", books)
 	})
 
 	e.GET("/authors", func(c echo.Context) error {
-		authors := findAllAuthors(coll)
+		authors := findAllAuthors(bookStore)
+		if isHxRequest(c) {
+			return c.Render(200, "authors-rows", authors)
+		}
 		return c.Render(200, "authors", authors)
 	})
 
 	e.GET("/years", func(c echo.Context) error {
-		years := findAllYears(coll)
+		years := findAllYears(bookStore)
+		if isHxRequest(c) {
+			return c.Render(200, "years-rows", years)
+		}
 		return c.Render(200, "years", years)
 	})
 
@@ -343,110 +911,287 @@ func main() {
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Reference/Methods
 	// It specifies the expected returned codes for each type of request
 	// method.
+	// Returns a JSON:API-flavoured envelope: `data` (the page of books, each
+	// carrying its own `self`/`author`/`year` links), `links` for paging
+	// through the collection, and `meta.total` for the overall count.
+	// Supports `?page=`, `?per_page=`, `?sort=year,-title`, and
+	// `?filter[author]=`/`?filter[year]=`.
 	e.GET("/api/books", func(c echo.Context) error {
-		books := findAllBooksApi(coll)
-		return c.JSON(http.StatusOK, books)
+		params := buildBookListParams(c)
+		page, perPage := parsePagination(c)
+
+		books, total, err := findAllBooksApi(bookStore, params)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		lastPage := int64(math.Ceil(float64(total) / float64(perPage)))
+		if lastPage < 1 {
+			lastPage = 1
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"data":  books,
+			"links": buildCollectionLinks(c, page, perPage, lastPage),
+			"meta":  map[string]interface{}{"total": total},
+		})
+	})
+
+	// Single book lookup. Sets an ETag for use with PUT/PATCH/DELETE's
+	// required If-Match, and honours If-None-Match with a bare 304 when the
+	// client's cached copy is still current.
+	e.GET("/api/books/:id", func(c echo.Context) error {
+		book, err := bookStore.Get(context.TODO(), c.Param("id"))
+		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		etag := bookETag(book)
+		c.Response().Header().Set("ETag", etag)
+		if c.Request().Header.Get("If-None-Match") == etag {
+			return c.NoContent(http.StatusNotModified)
+		}
+		return c.JSON(http.StatusOK, book)
+	})
+
+	// Audit trail for a single book, newest event first. 501 when the audit
+	// trail is disabled (see eventsColl's setup in main()).
+	e.GET("/api/books/:id/events", func(c echo.Context) error {
+		if eventsColl == nil {
+			return echo.NewHTTPError(http.StatusNotImplemented, "book_events audit trail requires mongo")
+		}
+
+		events, err := findEventsByBook(eventsColl, c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, events)
+	})
+
+	// Global audit trail, optionally filtered by `?since=<rfc3339>` and/or
+	// `?type=created|updated|deleted`. 501 when the audit trail is disabled
+	// (see eventsColl's setup in main()).
+	e.GET("/api/events", func(c echo.Context) error {
+		if eventsColl == nil {
+			return echo.NewHTTPError(http.StatusNotImplemented, "book_events audit trail requires mongo")
+		}
+
+		var since *time.Time
+		if raw := c.QueryParam("since"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "since must be RFC3339")
+			}
+			since = &parsed
+		}
+
+		events, err := findEvents(eventsColl, since, c.QueryParam("type"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, events)
+	})
+
+	// Full-text and structured search over the catalog, backing the form in
+	// views/search-bar.html. `?q=` is matched against the title/author text
+	// index; `?author=`, `?year_from=` and `?year_to=` narrow it further and
+	// all can be combined. Mongo-only (see findSearchResults) - returns 501
+	// when the active backend isn't Mongo. Renders the "search-results"
+	// fragment into #search-results on an HTMX GET, same as /books and
+	// friends; a plain GET gets the raw facets as JSON.
+	e.GET("/api/search", func(c echo.Context) error {
+		if searchColl == nil {
+			return echo.NewHTTPError(http.StatusNotImplemented, "full-text search requires the mongo storage backend")
+		}
+
+		yearFrom, err := parseOptionalYear(c, "year_from")
+		if err != nil {
+			return err
+		}
+		yearTo, err := parseOptionalYear(c, "year_to")
+		if err != nil {
+			return err
+		}
+
+		q := c.QueryParam("q")
+		facets, err := findSearchResults(searchColl, q, c.QueryParam("author"), yearFrom, yearTo)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		if isHxRequest(c) {
+			return c.Render(http.StatusOK, "search-results", facetsToSearchView(q, facets))
+		}
+		return c.JSON(http.StatusOK, facets)
 	})
 
 	// own POST, Update, Delete Methods -> Malaka lets go
 
-	// Some ideas for Post: https://echo.labstack.com/docs/request and https://developer.mozilla.org/en-US/docs/Web/HTTP/Reference/Methods/POST 
+	// Some ideas for Post: https://echo.labstack.com/docs/request and https://developer.mozilla.org/en-US/docs/Web/HTTP/Reference/Methods/POST
 	e.POST("/api/books", func(ctx echo.Context) error {
-		bookstore := new(BookStore)
+		book := new(store.Book)
 
-		// https://echo.labstack.com/docs/binding 
-		if err := ctx.Bind(bookstore); err != nil {
+		// https://echo.labstack.com/docs/binding
+		if err := ctx.Bind(book); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 
 		// debug
-		fmt.Printf("\nPOST: Empfangene Daten - ", bookstore)
+		fmt.Print("\nPOST: Empfangene Daten - ", book)
 
-		if bookstore.ID == "" {                       
-			bookstore.ID = primitive.NewObjectID().Hex()
+		if book.ID == "" {
+			book.ID = primitive.NewObjectID().Hex()
 		}
 
-		
-
-		// check for duplicated
-		// bson info: https://pkg.go.dev/go.mongodb.org/mongo-driver/bson 
-		filterDup := bson.M{
-			"id":      bookstore.ID,
-			"title": bookstore.BookName,
-			"author": bookstore.BookAuthor,
-			"pages": bookstore.BookPages,
-			"edition": bookstore.BookEdition,
-			"year": bookstore.BookYear,
+		// check for duplicated id. Now that storage is pluggable we can no
+		// longer build an arbitrary "match every field" filter, so this only
+		// rejects a clashing id - the unique index added by the migrations
+		// framework enforces the same thing server-side for Mongo.
+		if _, err := bookStore.Get(context.TODO(), book.ID); err == nil {
+			return echo.NewHTTPError(http.StatusConflict, "duplicate")
+		} else if err != store.ErrNotFound {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
-		// Find duplic. mongo https://www.mongodb.com/docs/manual/reference/method/db.collection.countDocuments/#:~:text=count()%20%2C%20db.-,collection.,documents%20in%20a%20sharded%20cluster.
-		n, err := coll.CountDocuments(context.TODO(), filterDup)
+		created, err := bookStore.Create(context.TODO(), *book)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		if n > 0 {
-			return echo.NewHTTPError(http.StatusConflict, "duplicate")
-		}
 
-		_, err = coll.InsertOne(context.TODO(), bookstore)
+		recordEvent(eventsColl, "created", created.ID, ctx.RealIP(), nil, &created)
 
-		if err != nil {
-        	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-    	}
 		fmt.Printf("\nPOST: DONE ")
-		return ctx.JSON(http.StatusCreated, bookstore)
+		if isHxRequest(ctx) {
+			return ctx.Render(http.StatusCreated, "book-row", bookToView(created))
+		}
+		return ctx.JSON(http.StatusCreated, created)
 	})
 
 
-	// PUT
+	// PUT is a full replacement: every field is required, missing ones are
+	// a 400 rather than silently keeping the old value (that's what PATCH,
+	// below, is for). Like PATCH and DELETE it requires a matching
+	// If-Match so two clients editing the same book can't silently clobber
+	// one another - see checkIfMatch and bookETag. checkIfMatch only
+	// rejects a client that's working off a stale read; the actual
+	// compare-and-swap against a concurrent editor happens inside
+	// bookStore.Update/Delete itself, which is given `before` as the
+	// expected current state and fails the whole write atomically
+	// (store.ErrConflict) if the book changed underneath us first.
 	e.PUT("/api/books/:id", func(ctx echo.Context) error {
 		id := ctx.Param("id")
 
-		bookstore := new(BookStore)
-		if err := ctx.Bind(bookstore); err != nil {
+		replacement := new(store.Book)
+		if err := ctx.Bind(replacement); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		if replacement.Title == "" || replacement.Author == "" || replacement.Edition == "" || replacement.Pages == "" || replacement.Year == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "PUT requires title, author, edition, pages and year")
+		}
 
-		// debug
-		fmt.Printf("\nPUT: Empfangene Daten - ", bookstore)
-
-		// Update: https://joshua-etim.medium.com/how-i-update-documents-in-mongodb-with-golang-94485dbe54f7 
-		// $set : https://www.mongodb.com/docs/manual/reference/operator/update/set/
-		updater := bson.M{"$set": bson.M{}}
-		if bookstore.BookName != "" { updater["$set"].(bson.M)["title"] = bookstore.BookName}
-		if bookstore.BookAuthor != "" { updater["$set"].(bson.M)["author"] = bookstore.BookAuthor}
-		if bookstore.BookEdition != "" { updater["$set"].(bson.M)["edition"] = bookstore.BookEdition}
-		if bookstore.BookPages != "" { updater["$set"].(bson.M)["pages"] = bookstore.BookPages}
-		if bookstore.BookYear != "" { updater["$set"].(bson.M)["year"] = bookstore.BookYear}
-
-		updateResult, err := coll.UpdateOne(context.TODO(), bson.M{"id": id}, updater)
+		before, err := bookStore.Get(context.TODO(), id)
 		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		if updateResult.MatchedCount == 0 {
-			return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+		if err := checkIfMatch(ctx, before); err != nil {
+			return err
 		}
 
-		fmt.Printf("\nPUT: DONE ")
+		after, err := bookStore.Update(context.TODO(), id, *replacement, before)
+		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
+			if err == store.ErrConflict {
+				return echo.NewHTTPError(http.StatusPreconditionFailed, "book was modified concurrently")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		recordEvent(eventsColl, "updated", id, ctx.RealIP(), &before, &after)
+
+		ctx.Response().Header().Set("ETag", bookETag(after))
+		if isHxRequest(ctx) {
+			return ctx.Render(http.StatusOK, "book-row", bookToView(after))
+		}
 		return ctx.NoContent(http.StatusOK)
 	})
 
-	// DELETE
-	e.DELETE("/api/books/:id", func(ctx echo.Context) error {
+	// PATCH is the partial update PUT used to be: any subset of fields may
+	// be sent, and only those are changed. Still requires If-Match.
+	e.PATCH("/api/books/:id", func(ctx echo.Context) error {
 		id := ctx.Param("id")
-		delete_res, _ := coll.DeleteOne(context.TODO(), bson.M{"id": id})
 
-		// debug
-		fmt.Printf("\nDELETE: Empfangene Daten - ", id)
+		patch := new(store.Book)
+		if err := ctx.Bind(patch); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		before, err := bookStore.Get(context.TODO(), id)
+		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if err := checkIfMatch(ctx, before); err != nil {
+			return err
+		}
+
+		after, err := bookStore.Update(context.TODO(), id, *patch, before)
+		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
+			if err == store.ErrConflict {
+				return echo.NewHTTPError(http.StatusPreconditionFailed, "book was modified concurrently")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		recordEvent(eventsColl, "updated", id, ctx.RealIP(), &before, &after)
 
+		ctx.Response().Header().Set("ETag", bookETag(after))
+		if isHxRequest(ctx) {
+			return ctx.Render(http.StatusOK, "book-row", bookToView(after))
+		}
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	// DELETE also requires If-Match, checked against the book as it stands
+	// right before deletion.
+	e.DELETE("/api/books/:id", func(ctx echo.Context) error {
+		id := ctx.Param("id")
+
+		before, err := bookStore.Get(context.TODO(), id)
 		if err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
-		if delete_res.DeletedCount == 0 {
-			return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+		if err := checkIfMatch(ctx, before); err != nil {
+			return err
+		}
+
+		if err := bookStore.Delete(context.TODO(), id, before); err != nil {
+			if err == store.ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Not found id")
+			}
+			if err == store.ErrConflict {
+				return echo.NewHTTPError(http.StatusPreconditionFailed, "book was modified concurrently")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 		}
 
-		fmt.Printf("\nDELETE: DONE ")
+		recordEvent(eventsColl, "deleted", id, ctx.RealIP(), &before, nil)
+
 		return ctx.NoContent(http.StatusOK)
 	})
 
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store/memory"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// newTestContext builds an echo.Context for a GET /api/books request with
+// the given raw query string, the way the real server would see it.
+func newTestContext(rawQuery string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/api/books?"+rawQuery, nil)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestBuildBookListParams(t *testing.T) {
+	c := newTestContext("page=2&per_page=5&sort=-title&filter[author]=Poe&filter[year]=1843")
+	params := buildBookListParams(c)
+
+	if params.Skip != 5 || params.Limit != 5 {
+		t.Fatalf("unexpected pagination: skip=%d limit=%d", params.Skip, params.Limit)
+	}
+	if params.Author != "Poe" {
+		t.Fatalf("expected author filter Poe, got %q", params.Author)
+	}
+	if params.Year != "1843" {
+		t.Fatalf("expected year filter 1843, got %q", params.Year)
+	}
+	if len(params.Sort) != 1 || params.Sort[0].Field != "title" || !params.Sort[0].Desc {
+		t.Fatalf("expected a single descending title sort key, got %+v", params.Sort)
+	}
+}
+
+func TestFindAllBooksApiPagination(t *testing.T) {
+	bs := memory.NewStore(
+		store.Book{ID: "1", Title: "A", Author: "Author1", Year: "2000"},
+		store.Book{ID: "2", Title: "B", Author: "Author2", Year: "2001"},
+		store.Book{ID: "3", Title: "C", Author: "Author3", Year: "2002"},
+	)
+
+	books, total, err := findAllBooksApi(bs, store.ListParams{Skip: 1, Limit: 1, Sort: []store.SortKey{{Field: "year"}}})
+	if err != nil {
+		t.Fatalf("findAllBooksApi: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("expected total 3 regardless of Skip/Limit, got %d", total)
+	}
+	if len(books) != 1 {
+		t.Fatalf("expected 1 book on this page, got %d", len(books))
+	}
+	if books[0]["id"] != "2" {
+		t.Fatalf("expected the second book by year, got %v", books[0]["id"])
+	}
+	if links, ok := books[0]["links"].(map[string]string); !ok || links["self"] != "/api/books/2" {
+		t.Fatalf("expected a self link to /api/books/2, got %v", books[0]["links"])
+	}
+}
+
+func TestBookETag(t *testing.T) {
+	a := store.Book{ID: "1", Title: "A", Author: "X", Edition: "E", Pages: "1", Year: "2000"}
+	b := a
+	b.Title = "A (2nd ed.)"
+
+	if bookETag(a) != bookETag(a) {
+		t.Fatal("expected a stable ETag for the same book")
+	}
+	if bookETag(a) == bookETag(b) {
+		t.Fatal("expected different ETags for different books")
+	}
+}
+
+func TestParseOptionalYear(t *testing.T) {
+	c := newTestContext("year_from=1800&year_to=not-a-number")
+
+	v, err := parseOptionalYear(c, "year_from")
+	if err != nil || v == nil || *v != 1800 {
+		t.Fatalf("expected 1800, got %v err=%v", v, err)
+	}
+
+	if v, err := parseOptionalYear(c, "missing"); err != nil || v != nil {
+		t.Fatalf("expected nil/nil for an absent parameter, got %v err=%v", v, err)
+	}
+
+	if _, err := parseOptionalYear(c, "year_to"); err == nil {
+		t.Fatal("expected a 400 for a non-numeric year_to")
+	}
+}
+
+func TestFacetsToSearchView(t *testing.T) {
+	facets := bson.M{
+		"results": bson.A{
+			bson.M{"id": "2", "title": "Frankenstein", "author": "Mary Shelley", "edition": "978-3-649-64609-9", "pages": int32(280), "year": "1818"},
+		},
+		"author_counts": bson.A{
+			bson.M{"_id": "Mary Shelley", "count": int32(1)},
+		},
+		"year_histogram": bson.A{
+			bson.M{"_id": int32(1818), "count": int64(1)},
+		},
+	}
+
+	view := facetsToSearchView("frankenstein", facets)
+
+	if view.Query != "frankenstein" {
+		t.Fatalf("expected query to be preserved, got %q", view.Query)
+	}
+	if len(view.Results) != 1 || view.Results[0].Title != "Frankenstein" || view.Results[0].Pages != "280" {
+		t.Fatalf("unexpected results: %+v", view.Results)
+	}
+	if len(view.AuthorCounts) != 1 || view.AuthorCounts[0].Count != 1 {
+		t.Fatalf("unexpected author counts: %+v", view.AuthorCounts)
+	}
+	if len(view.YearHistogram) != 1 || view.YearHistogram[0].Year != "1818" {
+		t.Fatalf("unexpected year histogram: %+v", view.YearHistogram)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	book := store.Book{ID: "1", Title: "A", Author: "X", Edition: "E", Pages: "1", Year: "2000"}
+
+	if err := checkIfMatch(newTestContext(""), book); err == nil {
+		t.Fatal("expected an error when If-Match is missing")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/books/1", nil)
+	req.Header.Set("If-Match", bookETag(book))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if err := checkIfMatch(c, book); err != nil {
+		t.Fatalf("expected a matching If-Match to pass, got %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/books/1", nil)
+	req.Header.Set("If-Match", `"stale"`)
+	c = echo.New().NewContext(req, httptest.NewRecorder())
+	if err := checkIfMatch(c, book); err == nil {
+		t.Fatal("expected a stale If-Match to fail")
+	}
+}
@@ -0,0 +1,231 @@
+// Package memory is an in-memory store.BookStore implementation. It backs
+// STORAGE_BACKEND=memory and, more importantly, lets handler unit tests run
+// without a Mongo or Postgres instance.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/marcolutz00/cc-ss24-exercise-1/store"
+)
+
+// Store implements store.BookStore with a mutex-guarded map. Not meant for
+// production use - there is no persistence across restarts.
+type Store struct {
+	mu    sync.Mutex
+	books map[string]store.Book
+	seq   int
+}
+
+// NewStore returns an empty in-memory store, optionally pre-seeded with
+// books (handy for tests that want fixture data without a Create round
+// trip).
+func NewStore(seed ...store.Book) *Store {
+	s := &Store{books: make(map[string]store.Book)}
+	for _, b := range seed {
+		s.books[b.ID] = b
+	}
+	return s
+}
+
+func (s *Store) List(ctx context.Context, params store.ListParams) ([]store.Book, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []store.Book
+	for _, b := range s.books {
+		if params.Author != "" && b.Author != params.Author {
+			continue
+		}
+		if params.Year != "" && b.Year != params.Year {
+			continue
+		}
+		matched = append(matched, b)
+	}
+
+	sortKeys := params.Sort
+	if len(sortKeys) == 0 {
+		sortKeys = []store.SortKey{{Field: "year"}}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		for _, key := range sortKeys {
+			cmp := compareField(matched[i], matched[j], key.Field)
+			if cmp == 0 {
+				continue
+			}
+			if key.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	total := int64(len(matched))
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = total
+	}
+	start := params.Skip
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return matched[start:end], total, nil
+}
+
+func fieldOf(b store.Book, field string) string {
+	switch field {
+	case "title":
+		return b.Title
+	case "author":
+		return b.Author
+	case "edition":
+		return b.Edition
+	default:
+		return b.Year
+	}
+}
+
+// compareField orders a and b on field the same way store/mongo's List
+// does: plain lexicographic for title/author/edition, but "year" parses
+// both sides as int first, since a lexicographic compare puts "10" before
+// "9" - the exact mixed-length problem store/mongo.List works around via
+// SafeToInt. Returns -1/0/1 like strings.Compare. Falls back to a
+// lexicographic compare if either Year isn't a valid int, rather than
+// panicking on malformed data.
+func compareField(a, b store.Book, field string) int {
+	if field == "year" {
+		ay, aErr := strconv.Atoi(a.Year)
+		by, bErr := strconv.Atoi(b.Year)
+		if aErr == nil && bErr == nil {
+			switch {
+			case ay < by:
+				return -1
+			case ay > by:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+
+	av, bv := fieldOf(a, field), fieldOf(b, field)
+	switch {
+	case av < bv:
+		return -1
+	case av > bv:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (s *Store) Get(ctx context.Context, id string) (store.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.books[id]
+	if !ok {
+		return store.Book{}, store.ErrNotFound
+	}
+	return b, nil
+}
+
+func (s *Store) Create(ctx context.Context, book store.Book) (store.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if book.ID == "" {
+		s.seq++
+		book.ID = "mem-" + strconv.Itoa(s.seq)
+	}
+	s.books[book.ID] = book
+	return book, nil
+}
+
+func (s *Store) Update(ctx context.Context, id string, patch store.Book, expected store.Book) (store.Book, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.books[id]
+	if !ok {
+		return store.Book{}, store.ErrNotFound
+	}
+	if existing != expected {
+		return store.Book{}, store.ErrConflict
+	}
+
+	if patch.Title != "" {
+		existing.Title = patch.Title
+	}
+	if patch.Author != "" {
+		existing.Author = patch.Author
+	}
+	if patch.Edition != "" {
+		existing.Edition = patch.Edition
+	}
+	if patch.Pages != "" {
+		existing.Pages = patch.Pages
+	}
+	if patch.Year != "" {
+		existing.Year = patch.Year
+	}
+
+	s.books[id] = existing
+	return existing, nil
+}
+
+func (s *Store) Delete(ctx context.Context, id string, expected store.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.books[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	if existing != expected {
+		return store.ErrConflict
+	}
+	delete(s.books, id)
+	return nil
+}
+
+func (s *Store) CountByAuthor(ctx context.Context) ([]store.AuthorCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int64)
+	for _, b := range s.books {
+		counts[b.Author]++
+	}
+
+	ret := make([]store.AuthorCount, 0, len(counts))
+	for author, count := range counts {
+		ret = append(ret, store.AuthorCount{Author: author, Count: count})
+	}
+	return ret, nil
+}
+
+func (s *Store) CountByYear(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var years []string
+	for _, b := range s.books {
+		if !seen[b.Year] {
+			seen[b.Year] = true
+			years = append(years, b.Year)
+		}
+	}
+	return years, nil
+}
@@ -0,0 +1,179 @@
+// Package migrations implements a small, dependency-free migration runner
+// for the Mongo-backed BookStore. Each Migration records its own version and
+// applies its changes exactly once; applied versions are tracked in a
+// `migrations` metadata collection so re-running the app never re-applies
+// them.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Version identifies a migration. By convention it looks like "1_0_0"
+// (mirroring a semantic version but underscore-separated, since Mongo index
+// and collection names are friendlier without dots).
+type Version string
+
+// Migration is one versioned, idempotent schema change. Up receives the
+// version the database is currently at (the empty Version if nothing has
+// run yet) so a migration could, in principle, behave differently depending
+// on what it is migrating from - the initial migration below ignores it.
+type Migration interface {
+	Version() string
+	Up(from Version) error
+}
+
+// Runner applies an ordered list of migrations against a database, skipping
+// any already recorded in the `migrations` metadata collection and failing
+// fast on the first error so a half-applied migration never gets marked as
+// done.
+type Runner struct {
+	metaColl *mongo.Collection
+}
+
+// NewRunner wires a Runner to db's `migrations` metadata collection.
+func NewRunner(db *mongo.Database) *Runner {
+	return &Runner{metaColl: db.Collection("migrations")}
+}
+
+// Run applies every migration in all that hasn't already been recorded as
+// applied, in the order given. Callers are responsible for listing
+// migrations in the order they must run.
+func (r *Runner) Run(ctx context.Context, all []Migration) error {
+	applied, err := r.appliedVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var current Version
+	for _, m := range all {
+		version := Version(m.Version())
+		if applied[version] {
+			current = version
+			continue
+		}
+
+		if err := m.Up(current); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Version(), err)
+		}
+
+		if _, err := r.metaColl.InsertOne(ctx, bson.M{
+			"version":    m.Version(),
+			"applied_at": time.Now().UTC(),
+		}); err != nil {
+			return fmt.Errorf("migration %s applied but failed to record: %w", m.Version(), err)
+		}
+
+		log.Printf("migrations: applied %s", m.Version())
+		current = version
+	}
+
+	return nil
+}
+
+func (r *Runner) appliedVersions(ctx context.Context) (map[Version]bool, error) {
+	cursor, err := r.metaColl.Find(ctx, bson.D{{}})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		Version string `bson:"version"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[Version]bool, len(docs))
+	for _, d := range docs {
+		applied[Version(d.Version)] = true
+	}
+	return applied, nil
+}
+
+// initialMigration is version 1_0_0: it creates a unique index on `id` and a
+// text index on `title`/`author`, and normalizes the `pages`/`year` fields
+// from string to int on any pre-existing documents.
+type initialMigration struct {
+	coll *mongo.Collection
+}
+
+// NewInitialMigration is the "1_0_0" migration for the books collection
+// passed in - see the initialMigration doc comment for what it does.
+func NewInitialMigration(coll *mongo.Collection) Migration {
+	return &initialMigration{coll: coll}
+}
+
+func (m *initialMigration) Version() string {
+	return "1_0_0"
+}
+
+func (m *initialMigration) Up(from Version) error {
+	ctx := context.Background()
+
+	if _, err := m.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"id", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"title", "text"}, {"author", "text"}}},
+	}); err != nil {
+		return err
+	}
+
+	return m.normalizeNumericFields(ctx)
+}
+
+// normalizeNumericFields turns `pages`/`year` from string into int on every
+// document that still stores them as strings. A document whose value can't
+// be parsed as a number is left untouched rather than failing the whole
+// migration - that's the "rollback path": the field rolls back to (stays)
+// its original string form and gets logged so it can be fixed by hand.
+func (m *initialMigration) normalizeNumericFields(ctx context.Context) error {
+	cursor, err := m.coll.Find(ctx, bson.D{{}})
+	if err != nil {
+		return err
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		update := bson.M{}
+		var unparsable []string
+
+		for _, field := range []string{"pages", "year"} {
+			raw, isString := doc[field].(string)
+			if !isString {
+				continue // already numeric (or missing) - nothing to do
+			}
+
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				unparsable = append(unparsable, field)
+				continue
+			}
+			update[field] = n
+		}
+
+		if len(unparsable) > 0 {
+			log.Printf("migrations: 1_0_0 left %v as-is on doc %v, not a valid number", unparsable, doc["_id"])
+		}
+		if len(update) == 0 {
+			continue
+		}
+
+		if _, err := m.coll.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": update}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
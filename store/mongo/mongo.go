@@ -0,0 +1,338 @@
+// Package mongo is the MongoDB-backed implementation of store.BookStore. It
+// is the original storage layer from before the backend abstraction existed,
+// just moved behind the interface and translating store.ListParams into the
+// bson.M/findOptions Mongo expects.
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/marcolutz00/cc-ss24-exercise-1/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// numericString decodes a field that the 1_0_0 migration (see
+// store/mongo/migrations) may have normalized from a BSON string to a BSON
+// int32/int64, transparently back to a Go string. This keeps "pages" and
+// "year" a plain string everywhere outside this package, regardless of
+// which on-disk representation a given document happens to have.
+type numericString string
+
+func (n *numericString) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		var s string
+		if err := bson.UnmarshalValue(t, data, &s); err != nil {
+			return err
+		}
+		*n = numericString(s)
+	case bsontype.Int32:
+		var v int32
+		if err := bson.UnmarshalValue(t, data, &v); err != nil {
+			return err
+		}
+		*n = numericString(strconv.Itoa(int(v)))
+	case bsontype.Int64:
+		var v int64
+		if err := bson.UnmarshalValue(t, data, &v); err != nil {
+			return err
+		}
+		*n = numericString(strconv.FormatInt(v, 10))
+	default:
+		return fmt.Errorf("numericString: unsupported bson type %s", t)
+	}
+	return nil
+}
+
+// document is the bson-mapped shape of a book as it is actually stored in
+// Mongo. It is private to this package - everything outside sees store.Book.
+type document struct {
+	ID      string        `bson:"id"`
+	Title   string        `bson:"title"`
+	Author  string        `bson:"author"`
+	Edition string        `bson:"edition"`
+	Pages   numericString `bson:"pages"`
+	Year    numericString `bson:"year"`
+}
+
+func (d document) toBook() store.Book {
+	return store.Book{
+		ID:      d.ID,
+		Title:   d.Title,
+		Author:  d.Author,
+		Edition: d.Edition,
+		Pages:   string(d.Pages),
+		Year:    string(d.Year),
+	}
+}
+
+func fromBook(b store.Book) document {
+	return document{
+		ID:      b.ID,
+		Title:   b.Title,
+		Author:  b.Author,
+		Edition: b.Edition,
+		Pages:   numericString(b.Pages),
+		Year:    numericString(b.Year),
+	}
+}
+
+// SafeToInt converts a Mongo field or expression to int the same way
+// $toInt would, except a value that isn't a valid number converts to nil
+// instead of aborting the whole aggregation with an error. The 1_0_0
+// migration (see store/mongo/migrations) deliberately leaves "year" as a
+// non-numeric string rather than guessing at it, so a bare $toInt on
+// "year" would take down every default-sorted /api/books listing the
+// moment one book has e.g. year: "TBD". nil sorts below every number, so
+// unparseable years sort to one end instead of 500ing the whole request;
+// in comparisons nil is less than any number and equal to another nil, so
+// $gte against a number excludes it but $lt/$lte (or $eq against another
+// nil) match it - callers that filter add an explicit $ne nil check.
+func SafeToInt(expr interface{}) bson.M {
+	return bson.M{"$convert": bson.M{"input": expr, "to": "int", "onError": nil, "onNull": nil}}
+}
+
+// Store implements store.BookStore on top of a *mongo.Collection.
+type Store struct {
+	coll *mongo.Collection
+}
+
+// NewStore wraps an already-prepared collection (see prepareDatabase in
+// cmd/main.go) as a store.BookStore.
+func NewStore(coll *mongo.Collection) *Store {
+	return &Store{coll: coll}
+}
+
+func (s *Store) List(ctx context.Context, params store.ListParams) ([]store.Book, int64, error) {
+	filter := bson.M{}
+	if params.Author != "" {
+		filter["author"] = params.Author
+	}
+	if params.Year != "" {
+		// "year" may be a BSON string or int depending on whether the
+		// 1_0_0 migration has normalized this particular document (see
+		// store/mongo/migrations) - a plain equality match would silently
+		// miss documents of the type it isn't comparing against, so both
+		// sides go through SafeToInt first, same as findSearchResults does
+		// for its year_from/year_to range. A document whose "year" isn't
+		// numeric converts to nil and never matches, instead of an
+		// unguarded $toInt aborting the whole query.
+		filter["$expr"] = bson.M{"$and": []interface{}{
+			bson.M{"$ne": []interface{}{SafeToInt("$year"), nil}},
+			bson.M{"$eq": []interface{}{SafeToInt("$year"), SafeToInt(params.Year)}},
+		}}
+	}
+
+	total, err := s.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Sorting by "year" has the same mixed-type problem as the filter
+	// above, and a regular Find() can't sort on a computed expression - so
+	// this runs as a one-stage-more aggregation that normalizes "year"
+	// into a throwaway field before sorting on it, instead of Find.
+	sortKeys := params.Sort
+	if len(sortKeys) == 0 {
+		sortKeys = []store.SortKey{{Field: "year"}}
+	}
+	addFields := bson.M{}
+	sortDoc := make(bson.D, 0, len(sortKeys))
+	for _, key := range sortKeys {
+		field := key.Field
+		if field == "year" {
+			field = "__year_sort"
+			addFields["__year_sort"] = SafeToInt("$year")
+		}
+		direction := 1
+		if key.Desc {
+			direction = -1
+		}
+		sortDoc = append(sortDoc, bson.E{Key: field, Value: direction})
+	}
+
+	pipeline := bson.A{bson.M{"$match": filter}}
+	if len(addFields) > 0 {
+		pipeline = append(pipeline, bson.M{"$addFields": addFields})
+	}
+	pipeline = append(pipeline, bson.M{"$sort": sortDoc})
+	if params.Skip > 0 {
+		pipeline = append(pipeline, bson.M{"$skip": params.Skip})
+	}
+	if params.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": params.Limit})
+	}
+	if len(addFields) > 0 {
+		pipeline = append(pipeline, bson.M{"$unset": "__year_sort"})
+	}
+
+	cursor, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var docs []document
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, 0, err
+	}
+
+	books := make([]store.Book, 0, len(docs))
+	for _, d := range docs {
+		books = append(books, d.toBook())
+	}
+	return books, total, nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (store.Book, error) {
+	var d document
+	if err := s.coll.FindOne(ctx, bson.M{"id": id}).Decode(&d); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return store.Book{}, store.ErrNotFound
+		}
+		return store.Book{}, err
+	}
+	return d.toBook(), nil
+}
+
+func (s *Store) Create(ctx context.Context, book store.Book) (store.Book, error) {
+	if _, err := s.coll.InsertOne(ctx, fromBook(book)); err != nil {
+		return store.Book{}, err
+	}
+	return book, nil
+}
+
+// casFilter builds the filter that makes Update/Delete a true
+// compare-and-swap: it matches id only if the document's current field
+// values still equal expected, so a concurrent writer that changed the
+// document after we read it causes the very next query to match zero
+// documents instead of silently clobbering that write. pages/year go
+// through $toString, since the 1_0_0 migration may have normalized either
+// to a BSON int.
+func casFilter(id string, expected store.Book) bson.M {
+	return bson.M{
+		"id":      id,
+		"title":   expected.Title,
+		"author":  expected.Author,
+		"edition": expected.Edition,
+		"$expr": bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$toString": "$pages"}, expected.Pages}},
+			bson.M{"$eq": bson.A{bson.M{"$toString": "$year"}, expected.Year}},
+		}},
+	}
+}
+
+// casError turns "0 documents matched casFilter" into the right typed
+// error: ErrNotFound if id is simply gone, ErrConflict if it still exists
+// but no longer looks like expected.
+func (s *Store) casError(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err == store.ErrNotFound {
+		return store.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return store.ErrConflict
+}
+
+func (s *Store) Update(ctx context.Context, id string, patch store.Book, expected store.Book) (store.Book, error) {
+	setFields := bson.M{}
+	if patch.Title != "" {
+		setFields["title"] = patch.Title
+	}
+	if patch.Author != "" {
+		setFields["author"] = patch.Author
+	}
+	if patch.Edition != "" {
+		setFields["edition"] = patch.Edition
+	}
+	if patch.Pages != "" {
+		setFields["pages"] = patch.Pages
+	}
+	if patch.Year != "" {
+		setFields["year"] = patch.Year
+	}
+
+	result, err := s.coll.UpdateOne(ctx, casFilter(id, expected), bson.M{"$set": setFields})
+	if err != nil {
+		return store.Book{}, err
+	}
+	if result.MatchedCount == 0 {
+		return store.Book{}, s.casError(ctx, id)
+	}
+
+	return s.Get(ctx, id)
+}
+
+func (s *Store) Delete(ctx context.Context, id string, expected store.Book) error {
+	result, err := s.coll.DeleteOne(ctx, casFilter(id, expected))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return s.casError(ctx, id)
+	}
+	return nil
+}
+
+func (s *Store) CountByAuthor(ctx context.Context) ([]store.AuthorCount, error) {
+	cursor, err := s.coll.Find(ctx, bson.D{{}})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []document
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, d := range docs {
+		counts[d.Author]++
+	}
+
+	ret := make([]store.AuthorCount, 0, len(counts))
+	for author, count := range counts {
+		ret = append(ret, store.AuthorCount{Author: author, Count: count})
+	}
+	return ret, nil
+}
+
+func (s *Store) CountByYear(ctx context.Context) ([]string, error) {
+	years, err := s.coll.Distinct(ctx, "year", bson.D{{}})
+	if err != nil {
+		return nil, err
+	}
+
+	// Distinct dedupes by BSON value, not by the string we convert it to -
+	// the 1_0_0 migration normalizes "year" to an int on disk, but
+	// numericString (see document above) has no MarshalBSONValue, so every
+	// Create still writes "year" back as a BSON string regardless. Once a
+	// deployment has migrated existing docs and then had a new book
+	// created, the same logical year can come back as both int32 1818 and
+	// string "1818", which Distinct treats as two distinct values. Dedupe
+	// on the converted string ourselves, same as memory.Store.CountByYear.
+	seen := make(map[string]bool)
+	ret := make([]string, 0, len(years))
+	for _, y := range years {
+		var str string
+		switch v := y.(type) {
+		case string:
+			str = v
+		case int32:
+			str = strconv.Itoa(int(v))
+		case int64:
+			str = strconv.FormatInt(v, 10)
+		default:
+			continue
+		}
+		if seen[str] {
+			continue
+		}
+		seen[str] = true
+		ret = append(ret, str)
+	}
+	return ret, nil
+}
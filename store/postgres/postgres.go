@@ -0,0 +1,235 @@
+// Package postgres is the Postgres-backed implementation of
+// store.BookStore, used when STORAGE_BACKEND=postgres. It exists so the
+// exercise can be run without a Mongo instance at hand.
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/marcolutz00/cc-ss24-exercise-1/store"
+)
+
+// yearOrderExpr sorts "year" numerically ("9" before "100") instead of
+// lexicographically, matching the Mongo and memory backends, which compare
+// years as ints for exactly this reason (commits 18d18b0, 9e18a9d) - a
+// plain "year" column reference would return a differently-ordered result
+// for the same ?sort=year depending on STORAGE_BACKEND. The CASE guards
+// against a non-numeric "year" (nothing validates it's a number on
+// Create), since a bare ::int cast would error the whole query on the
+// first bad row instead of just pushing it to one end of the sort.
+const yearOrderExpr = "(CASE WHEN year ~ '^-?[0-9]+$' THEN year::int END)"
+
+// Store implements store.BookStore on top of a *pgxpool.Pool.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// Connect opens a pool against dsn and makes sure the `books` table exists,
+// mirroring what prepareDatabase does for the Mongo collection.
+func Connect(ctx context.Context, dsn string) (*Store, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS books (
+			id      TEXT PRIMARY KEY,
+			title   TEXT NOT NULL DEFAULT '',
+			author  TEXT NOT NULL DEFAULT '',
+			edition TEXT NOT NULL DEFAULT '',
+			pages   TEXT NOT NULL DEFAULT '',
+			year    TEXT NOT NULL DEFAULT ''
+		)
+	`); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &Store{pool: pool}, nil
+}
+
+func scanBook(row pgx.Row) (store.Book, error) {
+	var b store.Book
+	if err := row.Scan(&b.ID, &b.Title, &b.Author, &b.Edition, &b.Pages, &b.Year); err != nil {
+		if err == pgx.ErrNoRows {
+			return store.Book{}, store.ErrNotFound
+		}
+		return store.Book{}, err
+	}
+	return b, nil
+}
+
+func (s *Store) List(ctx context.Context, params store.ListParams) ([]store.Book, int64, error) {
+	var conditions []string
+	args := []interface{}{}
+	if params.Author != "" {
+		args = append(args, params.Author)
+		conditions = append(conditions, "author = $"+strconv.Itoa(len(args)))
+	}
+	if params.Year != "" {
+		args = append(args, params.Year)
+		conditions = append(conditions, "year = $"+strconv.Itoa(len(args)))
+	}
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	countQuery := "SELECT count(*) FROM books " + whereClause
+	if err := s.pool.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Mirrors store.ListParams.Sort: each key becomes its own "field
+	// direction" clause, in order, so ties on an earlier key are broken by
+	// the next one - same semantics as the Mongo and memory backends.
+	orderBy := yearOrderExpr + " ASC"
+	if len(params.Sort) > 0 {
+		clauses := make([]string, 0, len(params.Sort))
+		for _, key := range params.Sort {
+			field := yearOrderExpr
+			switch key.Field {
+			case "title", "author", "edition":
+				field = key.Field
+			}
+			direction := "ASC"
+			if key.Desc {
+				direction = "DESC"
+			}
+			clauses = append(clauses, field+" "+direction)
+		}
+		orderBy = strings.Join(clauses, ", ")
+	}
+
+	// A Limit of 0 means "no limit", mirroring the Mongo driver's own
+	// FindOptions.Limit semantics - callers like the plain /books view rely
+	// on this to fetch everything in one page.
+	query := "SELECT id, title, author, edition, pages, year FROM books " + whereClause +
+		" ORDER BY " + orderBy
+	if params.Limit > 0 {
+		args = append(args, params.Limit, params.Skip)
+		query += " LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args))
+	} else if params.Skip > 0 {
+		args = append(args, params.Skip)
+		query += " OFFSET $" + strconv.Itoa(len(args))
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var books []store.Book
+	for rows.Next() {
+		b, err := scanBook(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		books = append(books, b)
+	}
+	return books, total, rows.Err()
+}
+
+func (s *Store) Get(ctx context.Context, id string) (store.Book, error) {
+	row := s.pool.QueryRow(ctx, "SELECT id, title, author, edition, pages, year FROM books WHERE id = $1", id)
+	return scanBook(row)
+}
+
+func (s *Store) Create(ctx context.Context, book store.Book) (store.Book, error) {
+	_, err := s.pool.Exec(ctx,
+		"INSERT INTO books (id, title, author, edition, pages, year) VALUES ($1, $2, $3, $4, $5, $6)",
+		book.ID, book.Title, book.Author, book.Edition, book.Pages, book.Year)
+	if err != nil {
+		return store.Book{}, err
+	}
+	return book, nil
+}
+
+// casError turns "0 rows matched the WHERE id=... AND <expected fields>"
+// into the right typed error: ErrNotFound if id is simply gone, ErrConflict
+// if it still exists but no longer looks like expected - i.e. someone else
+// wrote it after we read it.
+func (s *Store) casError(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err == store.ErrNotFound {
+		return store.ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return store.ErrConflict
+}
+
+func (s *Store) Update(ctx context.Context, id string, patch store.Book, expected store.Book) (store.Book, error) {
+	tag, err := s.pool.Exec(ctx, `
+		UPDATE books SET
+			title   = CASE WHEN $2 <> '' THEN $2 ELSE title END,
+			author  = CASE WHEN $3 <> '' THEN $3 ELSE author END,
+			edition = CASE WHEN $4 <> '' THEN $4 ELSE edition END,
+			pages   = CASE WHEN $5 <> '' THEN $5 ELSE pages END,
+			year    = CASE WHEN $6 <> '' THEN $6 ELSE year END
+		WHERE id = $1 AND title = $7 AND author = $8 AND edition = $9 AND pages = $10 AND year = $11
+	`, id, patch.Title, patch.Author, patch.Edition, patch.Pages, patch.Year,
+		expected.Title, expected.Author, expected.Edition, expected.Pages, expected.Year)
+	if err != nil {
+		return store.Book{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return store.Book{}, s.casError(ctx, id)
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Store) Delete(ctx context.Context, id string, expected store.Book) error {
+	tag, err := s.pool.Exec(ctx,
+		"DELETE FROM books WHERE id = $1 AND title = $2 AND author = $3 AND edition = $4 AND pages = $5 AND year = $6",
+		id, expected.Title, expected.Author, expected.Edition, expected.Pages, expected.Year)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return s.casError(ctx, id)
+	}
+	return nil
+}
+
+func (s *Store) CountByAuthor(ctx context.Context) ([]store.AuthorCount, error) {
+	rows, err := s.pool.Query(ctx, "SELECT author, count(*) FROM books GROUP BY author")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []store.AuthorCount
+	for rows.Next() {
+		var ac store.AuthorCount
+		if err := rows.Scan(&ac.Author, &ac.Count); err != nil {
+			return nil, err
+		}
+		ret = append(ret, ac)
+	}
+	return ret, rows.Err()
+}
+
+func (s *Store) CountByYear(ctx context.Context) ([]string, error) {
+	rows, err := s.pool.Query(ctx, "SELECT DISTINCT year FROM books")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var years []string
+	for rows.Next() {
+		var year string
+		if err := rows.Scan(&year); err != nil {
+			return nil, err
+		}
+		years = append(years, year)
+	}
+	return years, rows.Err()
+}
@@ -0,0 +1,111 @@
+// Package store defines the storage-backend-agnostic view of a "book" used
+// by the HTTP handlers in cmd/main.go. Before this package existed, handlers
+// talked to a *mongo.Collection directly; now they only ever see the
+// BookStore interface below, and picking a concrete implementation (Mongo,
+// Postgres, or an in-memory store for tests) is main()'s job alone.
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by Get/Update/Delete when no book matches the
+// given id, regardless of which backend is in use. Handlers translate it
+// into a 404.
+var ErrNotFound = errors.New("store: book not found")
+
+// ErrConflict is returned by Update/Delete when id exists but its current
+// field values no longer match the `expected` snapshot the caller passed
+// in - i.e. someone else wrote the book in between the caller reading it
+// and calling Update/Delete. Unlike ErrNotFound this is a compare-and-swap
+// failure checked atomically by the backend itself (inside the same
+// Mongo/Postgres query that performs the write), not a separate read
+// beforehand, so two concurrent editors can never both "win". Handlers
+// translate it into a 412.
+var ErrConflict = errors.New("store: expected value is stale")
+
+// Book is the plain, backend-agnostic representation of a book. It carries
+// no bson/sql tags - those live with the concrete implementations, which are
+// responsible for mapping to/from their own storage representation.
+type Book struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Author  string `json:"author"`
+	Edition string `json:"edition"`
+	Pages   string `json:"pages"`
+	Year    string `json:"year"`
+}
+
+// ListParams describes a single List() call: which page of results, in
+// which order, and (optionally) restricted to a single author/year. It
+// mirrors the `?page=`/`?per_page=`/`?sort=`/`?filter[author]=`/
+// `?filter[year]=` query parameters accepted by GET /api/books.
+type ListParams struct {
+	Skip   int64
+	Limit  int64
+	Author string // filter by exact author match; empty means no filter
+	Year   string // filter by exact year match; empty means no filter
+
+	// Sort is the ordered list of sort keys parsed from `?sort=year,-title`
+	// - field "title" breaks ties within equal "year" values, not the other
+	// way round. An empty Sort means "let the backend choose its default
+	// order".
+	Sort []SortKey
+}
+
+// SortKey is one element of a multi-key sort order: a field to sort by
+// ("title", "author", "year" or "edition") and whether it is descending -
+// the "-" prefix in the JSON:API-style `?sort=` query parameter.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// AuthorCount is one row of the CountByAuthor() report: an author and how
+// many books of theirs are on record.
+type AuthorCount struct {
+	Author string
+	Count  int64
+}
+
+// BookStore is the interface every storage backend must satisfy. Handlers
+// depend only on this interface - never on *mongo.Collection, *pgxpool.Pool,
+// or any other concrete client - which is what makes it possible to run the
+// exercise against Postgres, or against the in-memory store in tests,
+// without touching cmd/main.go.
+type BookStore interface {
+	// List returns the page of books described by params, plus the total
+	// number of books matching params.Author/params.Year (ignoring Skip/Limit), for
+	// pagination metadata.
+	List(ctx context.Context, params ListParams) ([]Book, int64, error)
+
+	// Get returns a single book by id, or ErrNotFound.
+	Get(ctx context.Context, id string) (Book, error)
+
+	// Create inserts a new book and returns it. Only the in-memory store
+	// assigns an ID when book.ID is empty; the Mongo and Postgres stores
+	// insert the book with the ID as given, empty or not.
+	Create(ctx context.Context, book Book) (Book, error)
+
+	// Update applies a partial update: only non-empty fields on patch are
+	// written. expected must match the book's current field values or the
+	// write is rejected with ErrConflict instead of applied - this is the
+	// compare-and-swap that makes If-Match safe against two concurrent
+	// editors, not just a stale retry (see store.ErrConflict). Returns the
+	// book as it looks after the update, or ErrNotFound if id doesn't
+	// exist.
+	Update(ctx context.Context, id string, patch Book, expected Book) (Book, error)
+
+	// Delete removes a book by id, subject to the same compare-and-swap as
+	// Update: expected must match the book's current field values or the
+	// call fails with ErrConflict. Returns ErrNotFound if id doesn't exist.
+	Delete(ctx context.Context, id string, expected Book) error
+
+	// CountByAuthor groups all books by author, for the /authors view.
+	CountByAuthor(ctx context.Context) ([]AuthorCount, error)
+
+	// CountByYear returns the distinct publication years on record, for the
+	// /years view.
+	CountByYear(ctx context.Context) ([]string, error)
+}